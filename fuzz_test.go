@@ -0,0 +1,35 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package tabwriter_test
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/cyberpossum/tabwriter"
+)
+
+func FuzzWrite(f *testing.F) {
+	for _, e := range tests {
+		f.Add(e.src, e.flags)
+	}
+	f.Fuzz(func(t *testing.T, src string, flags uint) {
+		for _, padchar := range []byte{'.', '\t'} {
+			w := NewWriter(ioutil.Discard, 4, 8, 1, padchar, flags).SetMinGap(2)
+			io.WriteString(w, src)
+			if err := w.FlushComplete(); err != nil {
+				t.Errorf("flush error: %v", err)
+			}
+			io.WriteString(w, src)
+			if err := w.Flush(); err != nil {
+				t.Errorf("flush error: %v", err)
+			}
+		}
+	})
+}
@@ -12,6 +12,7 @@
 package tabwriter
 
 import (
+	"bytes"
 	"io"
 	"unicode/utf8"
 )
@@ -21,13 +22,24 @@ import (
 
 // A cell represents a segment of text terminated by tabs or line breaks.
 // The text itself is stored in a separate buffer; cell only describes the
-// segment's size in bytes, its width in runes, and whether it's an htab
-// ('\t') terminated cell.
+// segment's size in bytes, its width in runes, whether it's an htab
+// ('\t') terminated cell, and whether it is ignored for column widths.
+// If the segment contains escaped line breaks, cell also refers to the
+// widths of its lines, which are kept separately as such cells are rare.
 //
 type cell struct {
-	size  int  // cell size in bytes
-	width int  // cell width in runes
-	htab  bool // true if the cell is terminated by an htab ('\t')
+	size   int   // cell size in bytes
+	width  int   // cell width in runes
+	htab   bool  // true if the cell is terminated by an htab ('\t')
+	ignore bool  // true if the cell does not contribute to its column width
+	brk    int32 // if > 0, the cell contains escaped line breaks; its lines are Writer.brks[brk-1]
+}
+
+// cellLines describes the lines of a cell containing escaped line breaks.
+type cellLines struct {
+	firstw int // width of the cell's first line in runes
+	innerw int // width of the widest line between the first and the last
+	brkw   int // part of the cell width not on the cell's last line
 }
 
 // A Writer is a filter that inserts padding around tab-delimited
@@ -65,6 +77,12 @@ type cell struct {
 // terminated by horizontal (or "hard") tabs are not affected by
 // this flag.
 //
+// If FilterIgnoreWidth is set, a cell containing an IgnoreWidth marker
+// does not contribute to the width of its column. The marker is stripped
+// from the output. Such a cell is padded to the column width like any
+// other cell if its width plus padding fits, and followed by just the
+// padding otherwise.
+//
 // If a Writer is configured to filter HTML, HTML tags and entities
 // are passed through. The widths of tags and entities are
 // assumed to be zero (tags) and one (entities) for formatting purposes.
@@ -76,7 +94,11 @@ type cell struct {
 // Escape characters are stripped from the output; otherwise they
 // are passed through as well. For the purpose of formatting, the
 // width of the escaped text is always computed excluding the Escape
-// characters.
+// characters. If the escaped text contains line breaks and the
+// LastLineWidth flag is set, only the text after the last line break
+// counts toward the width of the cell, measured from the start of the
+// cell's column, and the cell is padded after its text even if the
+// AlignRight flag is set.
 //
 // The formfeed character acts like a newline but it also terminates
 // all columns in the current line (effectively calling Flush). Tab-
@@ -94,17 +116,24 @@ type Writer struct {
 	minwidth int
 	tabwidth int
 	padding  int
+	mingap   int
 	padbytes [8]byte
 	flags    uint
+	sectsep  []byte // text written between sections; see SetSectionSeparator
 
 	// current state
-	buf     []byte   // collected text excluding tabs or line breaks
-	pos     int      // buffer position up to which cell.width of incomplete cell has been computed
-	cell    cell     // current incomplete cell; cell.width is up to buf[pos] excluding ignored sections
-	endChar byte     // terminating char of escaped sequence (Escape for escapes, '>', ';' for HTML tags/entities, or 0)
-	lines   [][]cell // list of lines; each line is a list of cells
-	widths  []int    // list of column widths in runes - re-used during formatting
-	pch     byte     // previously processed character
+	buf         []byte      // collected text excluding tabs or line breaks
+	pos         int         // buffer position up to which cell.width of incomplete cell has been computed
+	cell        cell        // current incomplete cell; cell.width is up to buf[pos] excluding ignored sections
+	endChar     byte        // terminating char of escaped sequence (Escape for escapes, '>', ';' for HTML tags/entities, or 0)
+	lines       [][]cell    // list of lines; each line is a list of cells
+	widths      []int       // list of column widths in runes - re-used during formatting
+	brks        []cellLines // lines of cells containing escaped line breaks
+	pch         byte        // previously processed character
+	sectpending bool        // true if the section separator is due before the next output
+
+	// statistics
+	maxlinew int // width of the widest line written since Init, in display columns
 }
 
 // addLine adds a new line.
@@ -142,6 +171,7 @@ func (b *Writer) reset() {
 	b.endChar = 0
 	b.lines = b.lines[0:0]
 	b.widths = b.widths[0:0]
+	b.brks = b.brks[0:0]
 	b.addLine(true)
 }
 
@@ -196,6 +226,15 @@ const (
 
 	// Handle ANSI SGR escape codes as 0-length runes
 	ANSIColors
+
+	// Measure a cell containing escaped line breaks by the width
+	// of its last line only (the line its padding is written on).
+	// Such cells are always left-aligned.
+	LastLineWidth
+
+	// Recognize IgnoreWidth markers and don't count the width of
+	// marked cells when computing column widths.
+	FilterIgnoreWidth
 )
 
 // Escape character code
@@ -223,6 +262,7 @@ func (b *Writer) Init(output io.Writer, minwidth, tabwidth, padding int, padchar
 	b.minwidth = minwidth
 	b.tabwidth = tabwidth
 	b.padding = padding
+	b.mingap = 0
 	for i := range b.padbytes {
 		b.padbytes[i] = padchar
 	}
@@ -231,12 +271,59 @@ func (b *Writer) Init(output io.Writer, minwidth, tabwidth, padding int, padchar
 		flags &^= AlignRight
 	}
 	b.flags = flags
+	b.sectsep = nil
+	b.sectpending = false
+	b.maxlinew = 0
 
 	b.reset()
 
 	return b
 }
 
+// SetMinGap sets the minimal gap between the end of a cell's text and
+// the start of the next column: at least mingap padchar bytes, or mingap
+// tabs if padchar is '\t', are written after every non-empty cell in a
+// column, including cells ignored for width. With a padchar other than
+// '\t', this is the same as a padding of at least mingap; with tab
+// padding, where padding is rounded up to the next tab stop, it
+// guarantees whole tabs. Init resets the gap to 0, so SetMinGap must be
+// called after Init.
+//
+func (b *Writer) SetMinGap(mingap int) *Writer {
+	if mingap < 0 {
+		panic("negative mingap")
+	}
+	b.mingap = mingap
+	return b
+}
+
+// SetSectionSeparator sets the text written between sections terminated
+// by a formfeed ('\f') character, e.g. "\n" for a blank line between
+// independently aligned sections. The separator is written as is, before
+// the first output of the section following the formfeed, so a trailing
+// formfeed doesn't produce a separator. Explicit calls to Flush are not
+// section boundaries. A nil or empty separator, the default, writes
+// nothing. Init resets the separator, so SetSectionSeparator must be
+// called after Init.
+//
+func (b *Writer) SetSectionSeparator(sep []byte) *Writer {
+	b.sectsep = append(b.sectsep[:0], sep...)
+	return b
+}
+
+// gapWidth returns the cell width needed after the text of a cell
+// so that at least mingap padchars are written as padding.
+func (b *Writer) gapWidth() int {
+	if b.mingap == 0 {
+		return 0
+	}
+	if b.padbytes[0] == '\t' && b.tabwidth > 0 {
+		// the first tab may advance by as little as one column
+		return (b.mingap-1)*b.tabwidth + 1
+	}
+	return b.mingap
+}
+
 // debugging support (keep code around)
 func (b *Writer) dump() {
 	pos := 0
@@ -258,6 +345,11 @@ type osError struct {
 }
 
 func (b *Writer) write0(buf []byte) {
+	if b.sectpending && len(buf) > 0 {
+		// first output of a new section
+		b.sectpending = false
+		b.write0(b.sectsep)
+	}
 	n, err := b.output.Write(buf)
 	if n != len(buf) && err == nil {
 		err = io.ErrShortWrite
@@ -280,24 +372,130 @@ var (
 	tabs    = []byte("\t\t\t\t\t\t\t\t")
 )
 
-func (b *Writer) writePadding(textw, cellw int, useTabs bool) {
+// tabPadding returns the number of tabs needed to pad a cell of text
+// width textw to cellw, and the display column reached if the padding
+// starts at display column x.
+func (b *Writer) tabPadding(x, textw, cellw int) (n, end int) {
+	if b.tabwidth == 0 {
+		return 0, x // tabs have no width - can't do any padding
+	}
+	// make cellw the smallest multiple of b.tabwidth
+	cellw = (cellw + b.tabwidth - 1) / b.tabwidth * b.tabwidth
+	n = cellw - textw // amount of padding
+	if n < 0 {
+		panic("internal error")
+	}
+	n = (n + b.tabwidth - 1) / b.tabwidth // number of tabs
+	if n > 0 {
+		x = (x/b.tabwidth + n) * b.tabwidth
+	}
+	return n, x
+}
+
+// padEnd returns the display column reached by padding a cell of text
+// width textw to cellw, starting at display column x.
+func (b *Writer) padEnd(x, textw, cellw int, useTabs bool) int {
+	if b.padbytes[0] == '\t' || useTabs {
+		_, x = b.tabPadding(x, textw, cellw)
+		return x
+	}
+	return x + cellw - textw
+}
+
+// writePadding pads a cell of text width textw to cellw. The padding
+// starts at display column x; the display column reached is returned.
+func (b *Writer) writePadding(x, textw, cellw int, useTabs bool) int {
 	if b.padbytes[0] == '\t' || useTabs {
 		// padding is done with tabs
-		if b.tabwidth == 0 {
-			return // tabs have no width - can't do any padding
-		}
-		// make cellw the smallest multiple of b.tabwidth
-		cellw = (cellw + b.tabwidth - 1) / b.tabwidth * b.tabwidth
-		n := cellw - textw // amount of padding
-		if n < 0 {
-			panic("internal error")
-		}
-		b.writeN(tabs, (n+b.tabwidth-1)/b.tabwidth)
-		return
+		n, x := b.tabPadding(x, textw, cellw)
+		b.writeN(tabs, n)
+		return x
 	}
 
 	// padding is done with non-tab characters
 	b.writeN(b.padbytes[0:], cellw-textw)
+	return x + cellw - textw
+}
+
+// lastLine reports whether cell c is measured by the last of its lines
+// only. Such a cell is always padded after its text.
+func (b *Writer) lastLine(c cell) bool {
+	return c.brk > 0 && b.flags&LastLineWidth != 0
+}
+
+// textWidth returns the width of the text of cell c in its column if
+// the cell starts at display column x.
+func (b *Writer) textWidth(x int, c cell) int {
+	if b.lastLine(c) {
+		// the last line starts at display column 0, not at x
+		return c.width - x
+	}
+	return c.width
+}
+
+// textEnd returns the display column reached by writing the text
+// of cell c at display column x.
+func (b *Writer) textEnd(x int, c cell) int {
+	if c.brk > 0 {
+		return c.width - b.brks[c.brk-1].brkw
+	}
+	return x + c.width
+}
+
+// cellWidth returns the width cell c of column j with text width textw
+// is padded to.
+func (b *Writer) cellWidth(j int, c cell, textw int) int {
+	cellw := b.widths[j]
+	if c.ignore && textw+b.padding > cellw {
+		// cell ignored for width doesn't fit its column;
+		// pad it as if it were alone in its column
+		cellw = textw + b.padding
+	}
+	if w := textw + b.gapWidth(); w > cellw {
+		cellw = w
+	}
+	return cellw
+}
+
+// lineStart returns the display column at which cell j of line starts
+// when the line is written by writeLines with the current column widths.
+func (b *Writer) lineStart(line []cell, j int) int {
+	useTabs := b.flags&TabIndent != 0
+	x := 0 // display column
+	for k, c := range line[:j] {
+		if k > 0 && b.flags&Debug != 0 {
+			x++
+		}
+		if c.size == 0 {
+			x = b.padEnd(x, c.width, b.widths[k], useTabs)
+			continue
+		}
+		useTabs = false
+		textw := b.textWidth(x, c)
+		cellw := b.cellWidth(k, c, textw)
+		if b.flags&AlignRight == 0 || b.lastLine(c) {
+			x = b.padEnd(b.textEnd(x, c), textw, cellw, false)
+		} else {
+			x = b.padEnd(x, textw, cellw, false)
+			x = b.textEnd(x, c)
+		}
+	}
+	return x
+}
+
+// updateCellLines records the lines of cell c, written at display
+// column x, that are ended by escaped line breaks.
+func (b *Writer) updateCellLines(x int, c cell) {
+	l := &b.brks[c.brk-1]
+	b.updateMaxLineWidth(x + l.firstw)
+	b.updateMaxLineWidth(l.innerw)
+}
+
+// updateMaxLineWidth records an output line of width w.
+func (b *Writer) updateMaxLineWidth(w int) {
+	if w > b.maxlinew {
+		b.maxlinew = w
+	}
 }
 
 var vbar = []byte{'|'}
@@ -310,35 +508,47 @@ func (b *Writer) writeLines(pos0 int, line0, line1 int) (pos int) {
 		// if TabIndent is set, use tabs to pad leading empty cells
 		useTabs := b.flags&TabIndent != 0
 
+		x := 0 // display column
 		for j, c := range line {
 			if j > 0 && b.flags&Debug != 0 {
 				// indicate column break
 				b.write0(vbar)
+				x++
 			}
 
 			if c.size == 0 {
 				// empty cell
 				if j < len(b.widths) {
-					b.writePadding(c.width, b.widths[j], useTabs)
+					x = b.writePadding(x, c.width, b.widths[j], useTabs)
 				}
 			} else {
 				// non-empty cell
 				useTabs = false
-				if b.flags&AlignRight == 0 { // align left
+				textw := b.textWidth(x, c)
+				if b.flags&AlignRight == 0 || b.lastLine(c) { // align left
 					b.write0(b.buf[pos : pos+c.size])
 					pos += c.size
+					if c.brk > 0 {
+						b.updateCellLines(x, c)
+					}
+					x = b.textEnd(x, c)
 					if j < len(b.widths) {
-						b.writePadding(c.width, b.widths[j], false)
+						x = b.writePadding(x, textw, b.cellWidth(j, c, textw), false)
 					}
 				} else { // align right
 					if j < len(b.widths) {
-						b.writePadding(c.width, b.widths[j], false)
+						x = b.writePadding(x, textw, b.cellWidth(j, c, textw), false)
 					}
 					b.write0(b.buf[pos : pos+c.size])
 					pos += c.size
+					if c.brk > 0 {
+						b.updateCellLines(x, c)
+					}
+					x = b.textEnd(x, c)
 				}
 			}
 		}
+		b.updateMaxLineWidth(x)
 
 		if i+1 == len(b.lines) {
 			// last buffered line - we don't have a newline, so just write
@@ -388,8 +598,15 @@ func (b *Writer) format(pos0 int, line0, line1 int) (pos int) {
 			}
 			// cell exists in this column
 			c := line[column]
+			textw := c.width
+			if b.lastLine(c) {
+				textw = b.textWidth(b.lineStart(line, column), c)
+			}
 			// update width
-			if w := c.width + b.padding; w > width {
+			if w := textw + b.padding; w > width && !c.ignore {
+				width = w
+			}
+			if w := textw + b.gapWidth(); w > width && c.size > 0 && !c.ignore {
 				width = w
 			}
 			// update discardable
@@ -437,6 +654,16 @@ func (b *Writer) updateWidth() {
 //
 const Escape = '\xff'
 
+// To exclude a cell from the computation of its column width, write an
+// IgnoreWidth marker anywhere in the cell and set the FilterIgnoreWidth
+// flag. For instance, the first cell in "\xfelong cell\tb\n" is aligned
+// with the other cells of its column if it fits, but it doesn't widen
+// the column if it doesn't.
+//
+// The value 0xfe was chosen because it cannot appear in a valid UTF-8 sequence.
+//
+const IgnoreWidth = '\xfe'
+
 // Start escaped mode.
 func (b *Writer) startEscape(ch byte) {
 	switch ch {
@@ -459,6 +686,10 @@ func (b *Writer) startEscape(ch byte) {
 func (b *Writer) endEscape() {
 	switch b.endChar {
 	case Escape:
+		if bytes.IndexByte(b.buf[b.pos:], '\n') >= 0 {
+			b.endEscapedLines()
+			break
+		}
 		b.updateWidth()
 		if b.flags&StripEscape == 0 {
 			b.cell.width -= 2 // don't count the Escape chars
@@ -473,6 +704,51 @@ func (b *Writer) endEscape() {
 	b.endChar = 0
 }
 
+// endEscapedLines terminates an escaped text segment containing line
+// breaks. It records the widths of the cell's lines and, if LastLineWidth
+// is set, measures the cell by its last line only.
+func (b *Writer) endEscapedLines() {
+	text := b.buf[b.pos:]
+	open := b.flags&StripEscape == 0 // text starts with the opening Escape char
+	// the closing Escape char is missing if Flush terminates an incomplete escape
+	closed := open && text[len(text)-1] == Escape
+	escw := utf8.RuneCount(text)
+
+	w := b.cell.width // width of the current line so far
+	if b.cell.brk > 0 {
+		w -= b.brks[b.cell.brk-1].brkw
+	}
+	if open {
+		w-- // don't count the opening Escape char
+	}
+	for i := bytes.IndexByte(text, '\n'); i >= 0; i = bytes.IndexByte(text, '\n') {
+		w += utf8.RuneCount(text[:i])
+		if b.cell.brk == 0 {
+			b.brks = append(b.brks, cellLines{firstw: w})
+			b.cell.brk = int32(len(b.brks))
+		} else if l := &b.brks[b.cell.brk-1]; w > l.innerw {
+			l.innerw = w
+		}
+		text = text[i+1:]
+		w = 0
+	}
+	w += utf8.RuneCount(text)
+	if closed {
+		w-- // don't count the closing Escape char
+	}
+
+	if b.flags&LastLineWidth != 0 {
+		// only count the text after the last line break
+		b.cell.width = w
+	} else {
+		b.cell.width += escw
+		if open {
+			b.cell.width -= 2 // don't count the Escape chars
+		}
+	}
+	b.brks[b.cell.brk-1].brkw = b.cell.width - w
+}
+
 // Terminate the current cell by adding it to the list of cells of the
 // current line. Returns the number of cells in that line.
 //
@@ -486,7 +762,7 @@ func (b *Writer) terminateCell(htab bool) int {
 
 func (b *Writer) handlePanic(err *error, op string) {
 	if e := recover(); e != nil {
-		if op == "Flush" {
+		if op == "Flush" || op == "FlushComplete" {
 			// If Flush ran into a panic, we still need to reset.
 			b.reset()
 		}
@@ -501,7 +777,8 @@ func (b *Writer) handlePanic(err *error, op string) {
 // Flush should be called after the last call to Write to ensure
 // that any data buffered in the Writer is written to output. Any
 // incomplete escape sequence at the end is considered
-// complete for formatting purposes.
+// complete for formatting purposes. If the output is a Tee,
+// Flush flushes the Tee as well.
 func (b *Writer) Flush() error {
 	return b.flush()
 }
@@ -511,6 +788,10 @@ func (b *Writer) Flush() error {
 func (b *Writer) flush() (err error) {
 	defer b.handlePanic(&err, "Flush")
 	b.flushNoDefers()
+	if t, ok := b.output.(*Tee); ok {
+		// flush the destinations of the tee as well
+		return t.Flush()
+	}
 	return nil
 }
 
@@ -532,6 +813,31 @@ func (b *Writer) flushNoDefers() {
 	b.reset()
 }
 
+// FlushComplete writes all complete lines buffered in the Writer to
+// output, as if the buffered text ended after the last line break. The
+// incomplete last line, if any, is retained in the Writer. It starts new
+// columns and is formatted together with the text written after it by
+// the next call to Flush or FlushComplete.
+func (b *Writer) FlushComplete() (err error) {
+	defer b.handlePanic(&err, "FlushComplete")
+
+	n := len(b.lines) - 1 // number of complete lines
+	if n == 0 {
+		return nil
+	}
+
+	// format complete lines
+	pos := b.format(0, 0, n)
+
+	// retain incomplete last line; swap rather than copy the line
+	// so that no two lines share a []cell when addLine re-uses them
+	b.buf = b.buf[:copy(b.buf, b.buf[pos:])]
+	b.pos -= pos
+	b.lines[0], b.lines[n] = b.lines[n], b.lines[0]
+	b.lines = b.lines[:1]
+	return nil
+}
+
 var hbar = []byte("---\n")
 
 // Write writes buf to the writer b.
@@ -567,6 +873,10 @@ func (b *Writer) Write(buf []byte) (n int, err error) {
 							// indicate section break
 							b.write0(hbar)
 						}
+						if ch == '\f' && len(b.sectsep) > 0 {
+							// separate from the next section
+							b.sectpending = true
+						}
 					}
 				}
 
@@ -589,6 +899,13 @@ func (b *Writer) Write(buf []byte) (n int, err error) {
 					n = i
 					b.startEscape(ch)
 				}
+			case IgnoreWidth:
+				if b.flags&FilterIgnoreWidth != 0 {
+					// strip marker
+					b.append(buf[n:i])
+					n = i + 1
+					b.cell.ignore = true
+				}
 			case '[':
 				if b.pch == esc && b.flags&ANSIColors != 0 {
 					b.append(buf[n:i])
@@ -620,9 +937,93 @@ func (b *Writer) Write(buf []byte) (n int, err error) {
 	return
 }
 
+// MaxLineWidth returns the width, in display columns, of the widest line
+// written to the output since the last call to Init. Tabs count as the
+// width they expand to at their position, lines of escaped text segments
+// are measured separately, and text ignored for formatting purposes
+// (HTML tags, ANSI color codes, Escape characters) does not count.
+// Text still buffered in the Writer is not included; call Flush first.
+//
+func (b *Writer) MaxLineWidth() int {
+	return b.maxlinew
+}
+
 // NewWriter allocates and initializes a new tabwriter.Writer.
 // The parameters are the same as for the Init function.
 //
 func NewWriter(output io.Writer, minwidth, tabwidth, padding int, padchar byte, flags uint) *Writer {
 	return new(Writer).Init(output, minwidth, tabwidth, padding, padchar, flags)
 }
+
+// ----------------------------------------------------------------------------
+// Tee
+
+// A Tee is an io.Writer that duplicates its writes to several destinations,
+// for use as the output of a Writer. Unlike io.MultiWriter, which stops at
+// the first failing destination, a Tee keeps writing to the destinations
+// that did not fail, so that they all receive the complete output. Write
+// errors are collected and reported by Flush, which also flushes the
+// destinations that buffer their output.
+//
+type Tee struct {
+	dsts []io.Writer
+	errs []error // errs[i] is the first error returned by dsts[i], if any
+}
+
+// NewTee returns a Tee writing to the given destinations.
+//
+func NewTee(dsts ...io.Writer) *Tee {
+	return &Tee{
+		dsts: append([]io.Writer(nil), dsts...),
+		errs: make([]error, len(dsts)),
+	}
+}
+
+// Write writes buf to all destinations that have not failed yet.
+// It only returns an error if all destinations have failed.
+//
+func (t *Tee) Write(buf []byte) (n int, err error) {
+	ok := false
+	for i, w := range t.dsts {
+		if t.errs[i] != nil {
+			continue // destination failed before
+		}
+		n, err := w.Write(buf)
+		if n != len(buf) && err == nil {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			t.errs[i] = err
+			continue
+		}
+		ok = true
+	}
+	if !ok && len(t.dsts) > 0 {
+		return 0, t.err()
+	}
+	return len(buf), nil
+}
+
+// Flush calls the Flush method of every destination that has not failed
+// and has a method Flush() error, such as a *bufio.Writer or a *Writer.
+// It returns the first error encountered by any destination, including
+// errors from earlier calls to Write.
+//
+func (t *Tee) Flush() error {
+	for i, w := range t.dsts {
+		if f, ok := w.(interface{ Flush() error }); ok && t.errs[i] == nil {
+			t.errs[i] = f.Flush()
+		}
+	}
+	return t.err()
+}
+
+// err returns the error of the first failed destination, if any.
+func (t *Tee) err() error {
+	for _, err := range t.errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
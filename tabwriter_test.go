@@ -5,7 +5,9 @@
 package tabwriter_test
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -178,6 +180,104 @@ var tests = []struct {
 		"abc\033[\tdef",
 	},
 
+	{
+		"1g esc multiline",
+		0, 0, 1, '.', StripEscape,
+		"\xffaaaa\nb\xff\tc\nddd\tc\n",
+		"aaaa\nb.c\nddd....c\n",
+	},
+
+	{
+		"1g esc multiline last line width stripped",
+		0, 0, 1, '.', StripEscape | LastLineWidth,
+		"\xffaaaa\nb\xff\tc\nddd\tc\n",
+		"aaaa\nb...c\nddd.c\n",
+	},
+
+	{
+		"1g esc multiline last line width",
+		0, 0, 1, '.', LastLineWidth,
+		"\xffaaaa\nb\xff\tc\nddd\tc\n",
+		"\xffaaaa\nb\xff...c\nddd.c\n",
+	},
+
+	{
+		"1g esc multiline last line width second column",
+		0, 0, 1, '.', StripEscape | LastLineWidth,
+		"x\t\xffaa\nb\xff\tc\nx\tddd\tc\n",
+		"x.aa\nb.....c\nx.ddd.c\n",
+	},
+
+	{
+		"1g esc multiline last line width second column wide",
+		0, 0, 1, '.', StripEscape | LastLineWidth,
+		"x\t\xffaa\nbbbbbbb\xff\tc\nx\tddd\tc\n",
+		"x.aa\nbbbbbbb.c\nx.ddd...c\n",
+	},
+
+	{
+		"1g esc multiline last line width second column right",
+		0, 0, 1, '.', StripEscape | LastLineWidth | AlignRight,
+		"x\t\xffaa\nb\xff\tc\nx\tddd\tc\n",
+		".xaa\nb.....c\n.x.dddc\n",
+	},
+
+	{
+		"1h ignore width",
+		0, 0, 1, '.', FilterIgnoreWidth,
+		"a\tb\n\xfeaaaaaa\tb\naa\tb\n",
+		"a..b\naaaaaa.b\naa.b\n",
+	},
+
+	{
+		"1h ignore width fills column",
+		0, 0, 1, '.', FilterIgnoreWidth,
+		"aaa\tb\n\xfeaaaa\tb\n",
+		"aaa.b\naaaa.b\n",
+	},
+
+	{
+		"1h ignore width only",
+		0, 0, 1, '.', FilterIgnoreWidth,
+		"\xfeaaaa\tb\n",
+		"aaaa.b\n",
+	},
+
+	{
+		"1h ignore width not filtered",
+		0, 0, 1, '.', 0,
+		"a\tb\n\xfeaaaaaa\tb\naa\tb\n",
+		"a.......b\n\xfeaaaaaa.b\naa......b\n",
+	},
+
+	{
+		"1h ignore width fits",
+		0, 0, 1, '.', FilterIgnoreWidth,
+		"a\xfe\tb\naaa\tb\n",
+		"a...b\naaa.b\n",
+	},
+
+	{
+		"1h ignore width align right",
+		0, 0, 1, '.', FilterIgnoreWidth | AlignRight,
+		"a\tb\t\n\xfeaaaaaa\tb\t\n",
+		".a.b\n.aaaaaa.b\n",
+	},
+
+	{
+		"1h ignore width tabs",
+		0, 8, 1, '\t', FilterIgnoreWidth,
+		"a\tb\n\xfeaaaaaa\tb\n\xfeaaaaaaaaaaaa\tb\n",
+		"a\tb\naaaaaa\tb\naaaaaaaaaaaa\tb\n",
+	},
+
+	{
+		"1h ignore width esc",
+		0, 0, 1, '.', FilterIgnoreWidth,
+		"\xff\xfe\xff.b\n", // marker inside escape is passed through
+		"\xff\xfe\xff.b\n",
+	},
+
 	{
 		"2",
 		8, 0, 1, '.', 0,
@@ -339,6 +439,27 @@ var tests = []struct {
 		"g) f&lt;o..|<b>bar</b>.....| non-terminated entity &amp",
 	},
 
+	{
+		"7h",
+		0, 0, 1, '.', FilterHTML,
+		"&amp;\t&#1234;\tx\naaa\t&lt;&gt;\tx\n", // named and numeric entities have width one
+		"&amp;...&#1234;..x\naaa.&lt;&gt;.x\n",
+	},
+
+	{
+		"7i",
+		0, 8, 1, ' ', 0,
+		"\ta\tb\n\t\taaa\tb\n",
+		" a b\n   aaa b\n",
+	},
+
+	{
+		"7i tab indent",
+		0, 8, 1, ' ', TabIndent, // tabs for leading empty cells, spaces for alignment
+		"\ta\tb\n\t\taaa\tb\n",
+		"\ta b\n\t\taaa b\n",
+	},
+
 	{
 		"8",
 		8, 0, 1, '*', 0,
@@ -681,6 +802,327 @@ func Test(t *testing.T) {
 	}
 }
 
+var minGapTests = []struct {
+	testname                  string
+	minwidth, padding, mingap int
+	padchar                   byte
+	flags                     uint
+	src, expected             string
+}{
+	{
+		"gap 2",
+		0, 0, 2, '.', 0,
+		"a\tb\naaaa\tb\n",
+		"a.....b\naaaa..b\n",
+	},
+
+	{
+		"gap 2 align right",
+		0, 0, 2, '.', AlignRight,
+		"a\tb\t\naaaa\tb\t\n",
+		".....a..b\n..aaaa..b\n",
+	},
+
+	{
+		"gap smaller than padding",
+		0, 3, 1, '.', 0,
+		"a\tb\naaaa\tb\n",
+		"a......b\naaaa...b\n",
+	},
+
+	{
+		"gap 2 tabs",
+		0, 1, 2, '\t', 0,
+		"aaa\tb\naaaaaaaa\tb\n", // padding 2 would write a single tab after "aaaaaaaa"
+		"aaa\t\t\tb\naaaaaaaa\t\tb\n",
+	},
+
+	{
+		"gap 2 leading empty cells",
+		0, 0, 2, '.', 0,
+		"\tx\n\t\ty\n", // no gap after empty cells
+		"x\ny\n",
+	},
+
+	{
+		"gap 2 tabs leading empty cells",
+		0, 1, 2, '\t', 0,
+		"\tx\n\t\ty\n",
+		"\tx\n\t\ty\n",
+	},
+
+	{
+		"gap 2 tabs ignore width",
+		0, 1, 2, '\t', FilterIgnoreWidth,
+		"a\tb\n\xfeaaaaaaaaaaaa\tb\n", // padding 2 would write a single tab after the ignored cell
+		"a\t\tb\naaaaaaaaaaaa\t\tb\n",
+	},
+
+	{
+		"gap 3 ignore width",
+		0, 1, 3, '.', FilterIgnoreWidth,
+		"a\tb\n\xfeaaaaaa\tb\n",
+		"a...b\naaaaaa...b\n",
+	},
+}
+
+func TestMinGap(t *testing.T) {
+	for _, e := range minGapTests {
+		var b buffer
+		b.init(1000)
+		w := NewWriter(&b, e.minwidth, 8, e.padding, e.padchar, e.flags).SetMinGap(e.mingap)
+		write(t, e.testname, w, e.src)
+		verify(t, e.testname, w, &b, e.src, e.expected)
+	}
+}
+
+var maxLineWidthTests = []struct {
+	testname string
+	padchar  byte
+	flags    uint
+	src      string
+	width    int
+}{
+	{
+		"spaces",
+		'.', 0,
+		"a\tbbb\tc\naaaa\tb\tcc\n",
+		11, // "aaaa.b...cc"
+	},
+
+	{
+		"tabs",
+		'\t', 0,
+		"aaaaaaaa\tb\n",
+		17, // "aaaaaaaa" padded to 16, followed by "b"
+	},
+
+	{
+		"debug",
+		'.', Debug,
+		"a\tb\n",
+		4, // "a.|b"
+	},
+
+	{
+		"html",
+		'.', FilterHTML,
+		"<b>a</b>\t&amp;\n",
+		3, // "a.&"
+	},
+
+	{
+		"multiline escape",
+		'.', LastLineWidth,
+		"\xffa\nbbb\xff",
+		3, // "bbb"
+	},
+
+	{
+		"unterminated multiline escape",
+		'.', LastLineWidth,
+		"\xffa\nbbb",
+		3, // "bbb"
+	},
+
+	{
+		"multiline escape wide first line",
+		'.', LastLineWidth,
+		"\xffaaaaaaaaaa\nb\xff\tc\n",
+		10, // "aaaaaaaaaa"
+	},
+
+	{
+		"multiline escape wide inner line",
+		'.', 0,
+		"x\t\xffa\naaaaa\naa\xff\n",
+		5, // "aaaaa"
+	},
+
+	{
+		"multiline escape full width",
+		'.', 0,
+		"\xffaaa\nb\xff\tc\n",
+		3, // "aaa", "b.c"
+	},
+
+	{
+		"debug tabs",
+		'\t', Debug,
+		"aaaaaaa\tb\tc\n",
+		18, // "aaaaaaa" padded to 8, "|b" padded to the next tab stop at 16, "|c"
+	},
+}
+
+func TestMaxLineWidth(t *testing.T) {
+	for _, e := range maxLineWidthTests {
+		var b buffer
+		b.init(1000)
+		w := NewWriter(&b, 0, 8, 1, e.padchar, e.flags)
+		write(t, e.testname, w, e.src)
+		if err := w.Flush(); err != nil {
+			t.Errorf("--- test: %s\n--- flush error: %v\n", e.testname, err)
+		}
+		if got := w.MaxLineWidth(); got != e.width {
+			t.Errorf("--- test: %s\n--- output:\n%q\n--- MaxLineWidth = %d, want %d\n", e.testname, b.String(), got, e.width)
+		}
+
+		w.Init(&b, 0, 8, 1, e.padchar, e.flags)
+		if got := w.MaxLineWidth(); got != 0 {
+			t.Errorf("--- test: %s\n--- MaxLineWidth after Init = %d, want 0\n", e.testname, got)
+		}
+	}
+}
+
+func TestFlushComplete(t *testing.T) {
+	var b buffer
+	b.init(1000)
+	w := NewWriter(&b, 0, 8, 1, '.', 0)
+
+	const name = "FlushComplete"
+	write(t, name, w, "ccc\t")
+	if err := w.FlushComplete(); err != nil {
+		t.Errorf("--- test: %s\n--- flush error: %v\n", name, err)
+	}
+	if res := b.String(); res != "" {
+		t.Errorf("--- test: %s\n--- found:\n%q\n--- expected no output\n", name, res)
+	}
+
+	b.clear()
+	write(t, name, w, "d\na\tb\nccc\td")
+	if err := w.FlushComplete(); err != nil {
+		t.Errorf("--- test: %s\n--- flush error: %v\n", name, err)
+	}
+	// widths are computed from the complete lines only
+	if res, expected := b.String(), "ccc.d\na...b\n"; res != expected {
+		t.Errorf("--- test: %s\n--- found:\n%q\n--- expected:\n%q\n", name, res, expected)
+	}
+
+	b.clear()
+	write(t, name, w, "\te\t\nc\td\te\n")
+	verify(t, name, w, &b, "ccc\td\te\t\nc\td\te\n", "ccc.d.e.\nc...d.e\n")
+}
+
+var sectionSeparatorTests = []struct {
+	testname      string
+	flags         uint
+	sep           string
+	src, expected string
+}{
+	{
+		"no separator",
+		0, "",
+		"a\tb\fccc\td\n",
+		"a.b\nccc.d\n",
+	},
+
+	{
+		"blank line",
+		0, "\n",
+		"a\tb\fccc\td\n",
+		"a.b\n\nccc.d\n",
+	},
+
+	{
+		"marker debug",
+		Debug, "===\n",
+		"a\tb\fccc\td\fe\n",
+		"a.|b\n---\n===\nccc.|d\n---\n===\ne\n",
+	},
+
+	{
+		"trailing formfeed",
+		0, "===\n",
+		"a\tb\fccc\td\f",
+		"a.b\n===\nccc.d\n",
+	},
+
+	{
+		"trailing formfeed debug",
+		Debug, "===\n",
+		"a\tb\f",
+		"a.|b\n---\n",
+	},
+}
+
+func TestSectionSeparator(t *testing.T) {
+	for _, e := range sectionSeparatorTests {
+		var b buffer
+		b.init(1000)
+		w := NewWriter(&b, 0, 8, 1, '.', e.flags).SetSectionSeparator([]byte(e.sep))
+		write(t, e.testname, w, e.src)
+		verify(t, e.testname, w, &b, e.src, e.expected)
+	}
+
+	// Flush is not a section boundary, and a pending separator survives it
+	const name = "flush"
+	var b buffer
+	b.init(1000)
+	w := NewWriter(&b, 0, 8, 1, '.', 0).SetSectionSeparator([]byte("===\n"))
+	write(t, name, w, "a\n")
+	if err := w.Flush(); err != nil {
+		t.Errorf("--- test: %s\n--- flush error: %v\n", name, err)
+	}
+	write(t, name, w, "b\f")
+	if err := w.Flush(); err != nil {
+		t.Errorf("--- test: %s\n--- flush error: %v\n", name, err)
+	}
+	write(t, name, w, "c\n")
+	verify(t, name, w, &b, "a\nb\fc\n", "a\nb\n===\nc\n")
+}
+
+type errorWriter struct {
+	err error
+}
+
+func (w errorWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestTee(t *testing.T) {
+	const (
+		name     = "Tee"
+		src      = "a\tb\naaa\tb\n"
+		expected = "a...b\naaa.b\n"
+	)
+	check := func(b *buffer) {
+		if res := b.String(); res != expected {
+			t.Errorf("--- test: %s\n--- src:\n%q\n--- found:\n%q\n--- expected:\n%q\n", name, src, res, expected)
+		}
+	}
+
+	var b1, b2, b3 buffer
+	b1.init(1000)
+	b2.init(1000)
+	b3.init(1000)
+	bw := bufio.NewWriter(&b3)
+	w := NewWriter(NewTee(&b1, &b2, bw), 0, 8, 1, '.', 0)
+	write(t, name, w, src)
+	verify(t, name, w, &b1, src, expected)
+	check(&b2)
+	check(&b3) // flushed by w.Flush
+
+	// an error from any destination is returned by Flush;
+	// the other destinations still receive all output
+	werr := errors.New("write failed")
+	b1.clear()
+	b2.clear()
+	w.Init(NewTee(&b1, errorWriter{werr}, &b2), 0, 8, 1, '.', 0)
+	write(t, name, w, src)
+	if err := w.Flush(); err != werr {
+		t.Errorf("--- test: %s\n--- flush error = %v, want %v\n", name, err, werr)
+	}
+	check(&b1)
+	check(&b2)
+
+	// a single failing destination
+	w.Init(NewTee(errorWriter{werr}), 0, 8, 1, '.', 0)
+	write(t, name, w, src)
+	if err := w.Flush(); err != werr {
+		t.Errorf("--- test: %s\n--- flush error = %v, want %v\n", name, err, werr)
+	}
+}
+
 type panicWriter struct{}
 
 func (panicWriter) Write([]byte) (int, error) {